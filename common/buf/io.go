@@ -2,6 +2,8 @@ package buf
 
 import (
 	"io"
+	"net"
+	"sync"
 	"time"
 
 	"v2ray.com/core/common/errors"
@@ -10,20 +12,55 @@ import (
 
 // Reader extends io.Reader with alloc.Buffer.
 type Reader interface {
-	// Read reads content from underlying reader, and put it into an alloc.Buffer.
-	Read() (MultiBuffer, error)
+	// ReadMultiBuffer reads content from underlying reader, and put it into an alloc.Buffer.
+	ReadMultiBuffer() (MultiBuffer, error)
 }
 
 var ErrReadTimeout = newError("IO timeout")
 
+// readError is returned by copyHandler.readFrom() to mark an error as
+// originating from the reader side of a Copy(), so callers such as outbound
+// handlers can tell a client-side abort from a broken upstream.
+type readError struct {
+	error
+}
+
+// Inner implements errors.hasInnerError.
+func (e readError) Inner() error {
+	return e.error
+}
+
+// IsReadError returns true if the error is caused by the reader in Copy().
+func IsReadError(err error) bool {
+	_, ok := err.(readError)
+	return ok
+}
+
+// writeError is returned by copyHandler.writeTo() to mark an error as
+// originating from the writer side of a Copy().
+type writeError struct {
+	error
+}
+
+// Inner implements errors.hasInnerError.
+func (e writeError) Inner() error {
+	return e.error
+}
+
+// IsWriteError returns true if the error is caused by the writer in Copy().
+func IsWriteError(err error) bool {
+	_, ok := err.(writeError)
+	return ok
+}
+
 type TimeoutReader interface {
 	ReadTimeout(time.Duration) (MultiBuffer, error)
 }
 
 // Writer extends io.Writer with alloc.Buffer.
 type Writer interface {
-	// Write writes an alloc.Buffer into underlying writer.
-	Write(MultiBuffer) error
+	// WriteMultiBuffer writes an alloc.Buffer into underlying writer.
+	WriteMultiBuffer(MultiBuffer) error
 }
 
 // ReadFrom creates a Supplier to read from a given io.Reader.
@@ -40,21 +77,166 @@ func ReadFullFrom(reader io.Reader, size int) Supplier {
 	}
 }
 
-func copyInternal(timer signal.ActivityTimer, reader Reader, writer Writer) error {
-	for {
-		buffer, err := reader.Read()
-		if err != nil {
+// SizeCounter is for storing bytes copied by Copy().
+type SizeCounter struct {
+	Size int64
+}
+
+// CopyOption is an option for Copy().
+type CopyOption func(*copyHandler)
+
+type copyHandler struct {
+	onReadError  []func(error) error
+	onWriteError []func(error) error
+	onData       []func(MultiBuffer)
+	readTimeout  time.Duration
+}
+
+// UpdateActivity is a CopyOption to update activity on each data copy.
+func UpdateActivity(timer signal.ActivityTimer) CopyOption {
+	return func(handler *copyHandler) {
+		handler.onData = append(handler.onData, func(MultiBuffer) {
+			timer.Update()
+		})
+	}
+}
+
+// IgnoreReaderError is a CopyOption to ignore errors from reader.
+func IgnoreReaderError() CopyOption {
+	return func(handler *copyHandler) {
+		handler.onReadError = append(handler.onReadError, func(err error) error {
+			if IsReadError(err) {
+				return nil
+			}
 			return err
+		})
+	}
+}
+
+// IgnoreWriterError is a CopyOption to ignore errors from writer.
+func IgnoreWriterError() CopyOption {
+	return func(handler *copyHandler) {
+		handler.onWriteError = append(handler.onWriteError, func(err error) error {
+			if IsWriteError(err) {
+				return nil
+			}
+			return err
+		})
+	}
+}
+
+// CountSize is a CopyOption that sums the total size of data copied into the given SizeCounter.
+func CountSize(sc *SizeCounter) CopyOption {
+	return func(handler *copyHandler) {
+		handler.onData = append(handler.onData, func(b MultiBuffer) {
+			sc.Size += int64(b.Len())
+		})
+	}
+}
+
+// CopyWithTimeout is a CopyOption that bounds how long a single read inside
+// Copy() may block. Readers that also implement TimeoutReader get
+// ReadTimeout(d) called directly, which actually cancels the pending read;
+// everything else falls back to a goroutine guarded by a time.Timer that
+// returns ErrReadTimeout if nothing arrives in time. On timeout, that
+// fallback closes the reader if it implements io.Closer, the same trick
+// mergingReader.Close() uses, to unblock the goroutine.
+//
+// KNOWN GAP: the original request for this option asked for a
+// ReadContext(ctx) method on BytesToBufferReader (the Reader NewReader hands
+// back for a plain io.Reader) so the pending read could be cancelled
+// properly. BytesToBufferReader lives in a sibling file that isn't part of
+// this chunk, so that method was never added here, and the contextReader
+// hook this series previously added for it was dead code and has been
+// removed. For a reader that is neither a TimeoutReader nor closeable, this
+// fallback still leaks one goroutine per timeout until the real read
+// eventually completes.
+func CopyWithTimeout(d time.Duration) CopyOption {
+	return func(handler *copyHandler) {
+		handler.readTimeout = d
+	}
+}
+
+type readResult struct {
+	mb  MultiBuffer
+	err error
+}
+
+func readWithTimeout(reader Reader, d time.Duration) (MultiBuffer, error) {
+	if tr, ok := reader.(TimeoutReader); ok {
+		return tr.ReadTimeout(d)
+	}
+
+	resultCh := make(chan readResult, 1)
+	go func() {
+		mb, err := reader.ReadMultiBuffer()
+		resultCh <- readResult{mb: mb, err: err}
+	}()
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case result := <-resultCh:
+		return result.mb, result.err
+	case <-timer.C:
+		if closer, ok := reader.(io.Closer); ok {
+			closer.Close()
 		}
+		return nil, ErrReadTimeout
+	}
+}
+
+// readFrom performs a single read and runs the onData/onReadError handler
+// chains. The third return value reports whether the underlying read
+// itself failed, even if an onReadError handler went on to swallow the
+// error to nil — copyInternal uses it to stop the loop instead of treating
+// a swallowed error as "got nothing, read again".
+func (handler *copyHandler) readFrom(reader Reader) (MultiBuffer, error, bool) {
+	var mb MultiBuffer
+	var err error
+	if handler.readTimeout > 0 {
+		mb, err = readWithTimeout(reader, handler.readTimeout)
+	} else {
+		mb, err = reader.ReadMultiBuffer()
+	}
+	if err != nil {
+		err = readError{err}
+		for _, f := range handler.onReadError {
+			err = f(err)
+		}
+		return nil, err, true
+	}
+	for _, f := range handler.onData {
+		f(mb)
+	}
+	return mb, nil, false
+}
+
+func (handler *copyHandler) writeTo(writer Writer, mb MultiBuffer) error {
+	err := writer.WriteMultiBuffer(mb)
+	if err != nil {
+		err = writeError{err}
+		for _, f := range handler.onWriteError {
+			err = f(err)
+		}
+	}
+	return err
+}
 
-		timer.Update()
+func copyInternal(reader Reader, writer Writer, handler *copyHandler) error {
+	for {
+		buffer, err, done := handler.readFrom(reader)
+		if done {
+			return err
+		}
 
 		if buffer.IsEmpty() {
 			buffer.Release()
 			continue
 		}
 
-		if err := writer.Write(buffer); err != nil {
+		if err := handler.writeTo(writer, buffer); err != nil {
 			buffer.Release()
 			return err
 		}
@@ -63,21 +245,71 @@ func copyInternal(timer signal.ActivityTimer, reader Reader, writer Writer) erro
 
 // Copy dumps all payload from reader to writer or stops when an error occurs.
 // ActivityTimer gets updated as soon as there is a payload.
-func Copy(timer signal.ActivityTimer, reader Reader, writer Writer) error {
-	err := copyInternal(timer, reader, writer)
+func Copy(reader Reader, writer Writer, options ...CopyOption) error {
+	handler := new(copyHandler)
+	for _, option := range options {
+		option(handler)
+	}
+
+	err := copyInternal(reader, writer, handler)
 	if err != nil && errors.Cause(err) != io.EOF {
 		return err
 	}
 	return nil
 }
 
+// CopyWithTimer is a thin wrapper around Copy() for callers that only need
+// activity tracking.
+//
+// BREAKING CHANGE, not source-compatible: the original backlog item asked to
+// keep the old Copy(timer, reader, writer) as a compatibility shim under the
+// name Copy, but Go has no overloading, and that name is now taken by the
+// options-based Copy(reader, writer, ...CopyOption) above. Every existing
+// call site written against the old positional-timer signature will fail to
+// compile and must be migrated by hand to either CopyWithTimer(timer,
+// reader, writer) or Copy(reader, writer, UpdateActivity(timer)).
+func CopyWithTimer(timer signal.ActivityTimer, reader Reader, writer Writer) error {
+	return Copy(reader, writer, UpdateActivity(timer))
+}
+
+// timeoutReader adapts a net.Conn into a TimeoutReader by setting a
+// per-call read deadline before delegating to the wrapped Reader.
+type timeoutReader struct {
+	conn   net.Conn
+	reader Reader
+}
+
+func (r *timeoutReader) ReadMultiBuffer() (MultiBuffer, error) {
+	return r.reader.ReadMultiBuffer()
+}
+
+func (r *timeoutReader) ReadTimeout(d time.Duration) (MultiBuffer, error) {
+	if err := r.conn.SetReadDeadline(time.Now().Add(d)); err != nil {
+		return nil, err
+	}
+	defer r.conn.SetReadDeadline(time.Time{})
+	return r.reader.ReadMultiBuffer()
+}
+
+// NewTimeoutReader creates a Reader that also implements TimeoutReader when
+// the underlying io.Reader is a net.Conn, bounding each read with
+// SetReadDeadline instead of a proxy hand-rolling its own timer goroutine.
+func NewTimeoutReader(reader io.Reader) Reader {
+	conn, ok := reader.(net.Conn)
+	if !ok {
+		return NewReader(reader)
+	}
+	return &timeoutReader{
+		conn:   conn,
+		reader: NewReader(reader),
+	}
+}
+
 // NewReader creates a new Reader.
 // The Reader instance doesn't take the ownership of reader.
 func NewReader(reader io.Reader) Reader {
-	if mr, ok := reader.(MultiBufferReader); ok {
-		return &readerAdpater{
-			MultiBufferReader: mr,
-		}
+	if r, ok := reader.(Reader); ok {
+		return r
 	}
 
 	return &BytesToBufferReader{
@@ -86,15 +318,213 @@ func NewReader(reader io.Reader) Reader {
 	}
 }
 
+// defaultMergeMaxWait bounds how long a merging Reader waits for more data
+// to coalesce onto a read that didn't fill its buffer on the first try.
+const defaultMergeMaxWait = 10 * time.Millisecond
+
+// mergeChunk is what mergingReader.pump() feeds back to readBlocking()/drain() for
+// readers that aren't a net.Conn.
+type mergeChunk struct {
+	data []byte
+	err  error
+}
+
+// mergingReader coalesces multiple small reads from the underlying
+// io.Reader into a single MultiBuffer. After an initial blocking read it
+// greedily drains more data - immediately, via SetReadDeadline(time.Now()),
+// when the reader is a net.Conn, or by polling a background pump goroutine
+// for up to maxWait otherwise - until buffer is full or nothing more is
+// immediately available. This cuts per-packet framing overhead for
+// protocols such as VMess/Shadowsocks, where each Read() would otherwise
+// become its own encrypted frame.
+type mergingReader struct {
+	reader     io.Reader
+	conn       net.Conn
+	pumpCh     chan mergeChunk
+	closeCh    chan struct{}
+	closeOnce  sync.Once
+	pending    []byte
+	pendingErr error
+	buffer     []byte
+	maxWait    time.Duration
+}
+
+// NewMergingReader creates a coalescing Reader using the package's default
+// max wait and buffer size.
 func NewMergingReader(reader io.Reader) Reader {
-	return NewMergingReaderSize(reader, 32*1024)
+	return NewMergingReaderSize(reader, defaultMergeMaxWait, 32*1024)
 }
 
-func NewMergingReaderSize(reader io.Reader, size uint32) Reader {
-	return &BytesToBufferReader{
-		reader: reader,
-		buffer: make([]byte, size),
+// NewMergingReaderSize creates a coalescing Reader whose internal buffer is
+// size bytes, waiting up to maxWait for additional data to arrive before
+// emitting whatever has been accumulated so far.
+func NewMergingReaderSize(reader io.Reader, maxWait time.Duration, size uint32) Reader {
+	mr := &mergingReader{
+		reader:  reader,
+		buffer:  make([]byte, size),
+		maxWait: maxWait,
+	}
+	if conn, ok := reader.(net.Conn); ok {
+		mr.conn = conn
+	} else {
+		mr.pumpCh = make(chan mergeChunk, 16)
+		mr.closeCh = make(chan struct{})
+		go mr.pump()
+	}
+	return mr
+}
+
+// Close stops the background pump goroutine, if one was started. It
+// implements io.Closer so a caller that abandons a mergingReader mid-stream
+// (e.g. Copy() returning early because the other leg of a pipe failed)
+// doesn't leak it. Closing closeCh alone only unblocks pump() when it is
+// parked trying to send on pumpCh; the common case is pump() blocked inside
+// r.reader.Read() itself, which closeCh can't interrupt. So, if the
+// underlying reader also implements io.Closer, Close it too - the same way
+// closing a net.Conn unblocks a goroutine parked in its Read() - to force
+// that pending read to return. Readers that are neither closed by this nor
+// otherwise cancellable still leak the pump goroutine until their own Read()
+// returns.
+func (r *mergingReader) Close() error {
+	if r.closeCh != nil {
+		r.closeOnce.Do(func() {
+			close(r.closeCh)
+			if closer, ok := r.reader.(io.Closer); ok {
+				closer.Close()
+			}
+		})
+	}
+	return nil
+}
+
+// pump feeds chunks read from r.reader into r.pumpCh so that readBlocking()
+// and drain() never call r.reader.Read() directly, which would race with pump
+// itself. Once closeCh is closed, it returns instead of blocking on a send to
+// pumpCh that has no reader left to drain it; closeCh does not interrupt a
+// pending r.reader.Read().
+func (r *mergingReader) pump() {
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := r.reader.Read(buf)
+		if n > 0 {
+			chunk := make([]byte, n)
+			copy(chunk, buf[:n])
+			select {
+			case r.pumpCh <- mergeChunk{data: chunk}:
+			case <-r.closeCh:
+				return
+			}
+		}
+		if err != nil {
+			select {
+			case r.pumpCh <- mergeChunk{err: err}:
+			case <-r.closeCh:
+			}
+			close(r.pumpCh)
+			return
+		}
+	}
+}
+
+func (r *mergingReader) fill(dst []byte) int {
+	n := copy(dst, r.pending)
+	r.pending = r.pending[n:]
+	return n
+}
+
+// readBlocking performs the initial, possibly-blocking read of ReadMultiBuffer().
+func (r *mergingReader) readBlocking(dst []byte) (int, error) {
+	if len(r.pending) > 0 {
+		return r.fill(dst), nil
+	}
+	if r.pendingErr != nil {
+		err := r.pendingErr
+		r.pendingErr = nil
+		return 0, err
+	}
+	if r.conn != nil {
+		return r.conn.Read(dst)
+	}
+
+	chunk, ok := <-r.pumpCh
+	if !ok {
+		return 0, io.EOF
+	}
+	if chunk.err != nil {
+		return 0, chunk.err
+	}
+	n := copy(dst, chunk.data)
+	if n < len(chunk.data) {
+		r.pending = chunk.data[n:]
 	}
+	return n, nil
+}
+
+// drain appends whatever is immediately available into dst and reports how
+// many bytes were added, without blocking longer than maxWait.
+func (r *mergingReader) drain(dst []byte) int {
+	if len(r.pending) > 0 {
+		return r.fill(dst)
+	}
+	if r.pendingErr != nil {
+		return 0
+	}
+
+	if r.conn != nil {
+		if err := r.conn.SetReadDeadline(time.Now()); err != nil {
+			return 0
+		}
+		defer r.conn.SetReadDeadline(time.Time{})
+		n, err := r.conn.Read(dst)
+		if err != nil {
+			// A timeout here just means there was nothing to read
+			// immediately, which is the expected outcome of the opportunistic
+			// poll. Anything else is a genuine connection error and must be
+			// surfaced on the next read instead of silently dropped.
+			if ne, ok := err.(net.Error); !ok || !ne.Timeout() {
+				r.pendingErr = err
+			}
+			return 0
+		}
+		return n
+	}
+
+	select {
+	case chunk, ok := <-r.pumpCh:
+		if !ok {
+			return 0
+		}
+		if chunk.err != nil {
+			r.pendingErr = chunk.err
+			return 0
+		}
+		n := copy(dst, chunk.data)
+		if n < len(chunk.data) {
+			r.pending = chunk.data[n:]
+		}
+		return n
+	case <-time.After(r.maxWait):
+		return 0
+	}
+}
+
+func (r *mergingReader) ReadMultiBuffer() (MultiBuffer, error) {
+	n, err := r.readBlocking(r.buffer)
+	if err != nil {
+		return nil, err
+	}
+
+	for n < len(r.buffer) {
+		added := r.drain(r.buffer[n:])
+		if added == 0 {
+			break
+		}
+		n += added
+	}
+
+	b := make([]byte, n)
+	copy(b, r.buffer[:n])
+	return NewMultiBufferValue(b), nil
 }
 
 // ToBytesReader converts a Reaaer to io.Reader.
@@ -104,12 +534,40 @@ func ToBytesReader(stream Reader) io.Reader {
 	}
 }
 
+// tcpVectorWriter writes a MultiBuffer to a *net.TCPConn via net.Buffers,
+// turning what would otherwise be one syscall per sub-buffer into a single
+// vectored writev(2).
+type tcpVectorWriter struct {
+	conn *net.TCPConn
+}
+
+// WriteMultiBuffer releases mb itself on success, matching the contract the
+// rest of Copy() relies on: callers (e.g. copyInternal) release mb when this
+// returns an error, so releasing here too would double-release the same
+// buffers back into the pool.
+func (w *tcpVectorWriter) WriteMultiBuffer(mb MultiBuffer) error {
+	if mb.IsEmpty() {
+		mb.Release()
+		return nil
+	}
+
+	nb := mb.ToNetBuffers()
+	if _, err := nb.WriteTo(w.conn); err != nil {
+		return err
+	}
+
+	mb.Release()
+	return nil
+}
+
 // NewWriter creates a new Writer.
 func NewWriter(writer io.Writer) Writer {
-	if mw, ok := writer.(MultiBufferWriter); ok {
-		return &writerAdapter{
-			writer: mw,
-		}
+	if w, ok := writer.(Writer); ok {
+		return w
+	}
+
+	if conn, ok := writer.(*net.TCPConn); ok {
+		return &tcpVectorWriter{conn: conn}
 	}
 
 	return &BufferToBytesWriter{
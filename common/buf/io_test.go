@@ -0,0 +1,235 @@
+package buf_test
+
+import (
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	. "v2ray.com/core/common/buf"
+	verrors "v2ray.com/core/common/errors"
+)
+
+type fakeReader struct {
+	reads int
+	max   int
+}
+
+func (r *fakeReader) ReadMultiBuffer() (MultiBuffer, error) {
+	r.reads++
+	if r.reads > r.max {
+		return nil, io.EOF
+	}
+	return NewMultiBufferValue([]byte{byte(r.reads)}), nil
+}
+
+type discardWriter struct {
+	written int
+}
+
+func (w *discardWriter) WriteMultiBuffer(mb MultiBuffer) error {
+	w.written += mb.Len()
+	mb.Release()
+	return nil
+}
+
+func TestCopyIgnoreReaderErrorStopsAfterFirstError(t *testing.T) {
+	reader := &fakeReader{max: 3}
+	writer := new(discardWriter)
+
+	if err := Copy(reader, writer, IgnoreReaderError()); err != nil {
+		t.Fatalf("unexpected error from Copy: %v", err)
+	}
+
+	if reader.reads != reader.max+1 {
+		t.Fatalf("got %d reads, want %d: IgnoreReaderError() should stop the loop on the first swallowed error, not busy-loop", reader.reads, reader.max+1)
+	}
+}
+
+func TestCopyCountSize(t *testing.T) {
+	reader := &fakeReader{max: 5}
+	writer := new(discardWriter)
+	var counter SizeCounter
+
+	if err := Copy(reader, writer, CountSize(&counter)); err != nil {
+		t.Fatalf("unexpected error from Copy: %v", err)
+	}
+
+	if counter.Size != int64(reader.max) {
+		t.Fatalf("got size %d, want %d", counter.Size, reader.max)
+	}
+	if writer.written != reader.max {
+		t.Fatalf("got %d bytes written, want %d", writer.written, reader.max)
+	}
+}
+
+func TestIsReadWriteError(t *testing.T) {
+	// Copy() swallows io.EOF itself, so exercise readError/writeError
+	// detection through a reader/writer that fails with something else.
+	boom := errors.New("boom")
+	failingReader := failReader{err: boom}
+	if err := Copy(failingReader, new(discardWriter)); !IsReadError(err) {
+		t.Fatalf("expected IsReadError to recognize a reader failure, got %v", err)
+	}
+
+	failingWriter := failWriter{err: boom}
+	okReader := &fakeReader{max: 1}
+	if err := Copy(okReader, failingWriter); !IsWriteError(err) {
+		t.Fatalf("expected IsWriteError to recognize a writer failure, got %v", err)
+	}
+}
+
+// TestTCPVectorWriter exercises NewWriter()'s *net.TCPConn fast path end to
+// end, so a bug in tcpVectorWriter.WriteMultiBuffer (e.g. calling WriteTo on
+// an unaddressable net.Buffers value) fails the build/test instead of only
+// surfacing against a live proxied connection.
+func TestTCPVectorWriter(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer ln.Close()
+
+	serverCh := make(chan net.Conn, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			serverCh <- nil
+			return
+		}
+		serverCh <- conn
+	}()
+
+	client, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatalf("failed to dial: %v", err)
+	}
+	defer client.Close()
+
+	server := <-serverCh
+	if server == nil {
+		t.Fatal("failed to accept connection")
+	}
+	defer server.Close()
+
+	tcpClient, ok := client.(*net.TCPConn)
+	if !ok {
+		t.Fatal("dialed connection is not a *net.TCPConn")
+	}
+
+	writer := NewWriter(tcpClient)
+	payload := []byte("hello vectored write")
+	if err := writer.WriteMultiBuffer(NewMultiBufferValue(payload)); err != nil {
+		t.Fatalf("WriteMultiBuffer failed: %v", err)
+	}
+
+	got := make([]byte, len(payload))
+	if _, err := io.ReadFull(server, got); err != nil {
+		t.Fatalf("failed to read from server: %v", err)
+	}
+	if string(got) != string(payload) {
+		t.Fatalf("got %q, want %q", got, payload)
+	}
+}
+
+// blockingCloser never returns from Read until Close is called, modeling a
+// reader whose pending Read can only be interrupted by closing it.
+type blockingCloser struct {
+	closed chan struct{}
+}
+
+func (r *blockingCloser) Read([]byte) (int, error) {
+	<-r.closed
+	return 0, io.ErrClosedPipe
+}
+
+func (r *blockingCloser) Close() error {
+	select {
+	case <-r.closed:
+	default:
+		close(r.closed)
+	}
+	return nil
+}
+
+func TestMergingReaderCloseUnblocksPump(t *testing.T) {
+	reader := &blockingCloser{closed: make(chan struct{})}
+	mr := NewMergingReader(reader)
+
+	closer, ok := mr.(io.Closer)
+	if !ok {
+		t.Fatal("mergingReader does not implement io.Closer")
+	}
+
+	done := make(chan struct{})
+	go func() {
+		closer.Close()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Close() did not return promptly")
+	}
+
+	select {
+	case <-reader.closed:
+	case <-time.After(time.Second):
+		t.Fatal("Close() did not unblock the underlying reader's pending Read(), so pump() would stay leaked")
+	}
+}
+
+// blockingMultiBufferReadCloser never returns from ReadMultiBuffer until
+// Close is called, modeling the closeable-but-not-TimeoutReader readers that
+// CopyWithTimeout's fallback path is meant to unblock on timeout.
+type blockingMultiBufferReadCloser struct {
+	closed chan struct{}
+}
+
+func (r *blockingMultiBufferReadCloser) ReadMultiBuffer() (MultiBuffer, error) {
+	<-r.closed
+	return nil, io.ErrClosedPipe
+}
+
+func (r *blockingMultiBufferReadCloser) Close() error {
+	select {
+	case <-r.closed:
+	default:
+		close(r.closed)
+	}
+	return nil
+}
+
+func TestCopyWithTimeoutClosesReaderOnTimeout(t *testing.T) {
+	reader := &blockingMultiBufferReadCloser{closed: make(chan struct{})}
+
+	err := Copy(reader, new(discardWriter), CopyWithTimeout(10*time.Millisecond))
+	if verrors.Cause(err) != ErrReadTimeout {
+		t.Fatalf("expected ErrReadTimeout, got %v", err)
+	}
+
+	select {
+	case <-reader.closed:
+	case <-time.After(time.Second):
+		t.Fatal("CopyWithTimeout did not close the reader on timeout, leaking its goroutine")
+	}
+}
+
+type failReader struct {
+	err error
+}
+
+func (r failReader) ReadMultiBuffer() (MultiBuffer, error) {
+	return nil, r.err
+}
+
+type failWriter struct {
+	err error
+}
+
+func (w failWriter) WriteMultiBuffer(mb MultiBuffer) error {
+	mb.Release()
+	return w.err
+}